@@ -25,13 +25,16 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/coreos/etcd-starter/Godeps/_workspace/src/github.com/coreos/etcd/client"
 	"github.com/coreos/etcd-starter/Godeps/_workspace/src/github.com/coreos/etcd/etcdmain"
 	"github.com/coreos/etcd-starter/Godeps/_workspace/src/github.com/coreos/etcd/migrate"
 	"github.com/coreos/etcd-starter/Godeps/_workspace/src/github.com/coreos/etcd/pkg/flags"
 	"github.com/coreos/etcd-starter/Godeps/_workspace/src/github.com/coreos/etcd/pkg/osutil"
+	"github.com/coreos/etcd-starter/Godeps/_workspace/src/github.com/coreos/etcd/pkg/transport"
 	"github.com/coreos/etcd-starter/Godeps/_workspace/src/github.com/coreos/etcd/wal"
 	"github.com/coreos/etcd-starter/Godeps/_workspace/src/golang.org/x/net/context"
 )
@@ -49,11 +52,30 @@ const (
 	v2_0Proxy version = "v2.0 proxy"
 	empty     version = "empty"
 	unknown   version = "unknown"
+
+	// migrationSnapshotPath is the v2 endpoint, introduced alongside the
+	// v0.4->v2 migration tooling, that serves a v2-compatible snapshot of
+	// a running peer's state.
+	migrationSnapshotPath = "/v2/migration/snapshot"
+
+	// defaultProbeTimeout is used when -starter-probe-timeout is not set.
+	defaultProbeTimeout = 5 * time.Second
+	// dialTimeout bounds how long a probe waits to dial and TLS-handshake
+	// a single peer.
+	dialTimeout = 2 * time.Second
+	// maxConcurrentProbes bounds how many peers are probed at once, so a
+	// large peer list doesn't open an unbounded number of connections.
+	maxConcurrentProbes = 8
 )
 
 var (
+	// v2SpecialFlags are flags that only make sense for etcd 2.0, so their
+	// presence means the node should start 2.0 regardless of what's in
+	// data-dir. initial-cluster is deliberately not here: it is also used
+	// to bootstrap via --initial-cluster-state, which needs its own
+	// version detection in the wal.WALNotExist branch of
+	// checkInternalVersion.
 	v2SpecialFlags = []string{
-		"initial-cluster",
 		"listen-peer-urls",
 		"listen-client-urls",
 		"proxy",
@@ -66,37 +88,170 @@ func StartDesiredVersion(binDir string, args []string) {
 		return
 	}
 
-	ver := checkInternalVersion(fs)
+	if dryRun(fs) {
+		plan, err := PlanDesiredVersion(binDir, args)
+		if err != nil {
+			log.Printf("etcd-starter: failed to build plan: %v", err)
+			return
+		}
+		b, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			log.Printf("etcd-starter: failed to marshal plan: %v", err)
+			return
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	ver := checkInternalVersion(fs, nil)
 	fmt.Printf("etcd-starter: starting etcd version %s\n", ver)
-	var p string
-	switch ver {
-	case internalV1:
-		p = path.Join(binDir, "1", "etcd")
-	case internalV2:
-		p = path.Join(binDir, "2", "etcd")
-	case internalV2Proxy:
-		p = path.Join(binDir, "2", "etcd")
+	p, err := binPathForVersion(binDir, ver)
+	if err != nil {
+		log.Panicf("etcd-starter: %v", err)
+	}
+	execArgs := filterStarterFlags(args)
+	if ver == internalV2Proxy {
 		if _, err := os.Stat(standbyInfo4(fs.Lookup("data-dir").Value.String())); err != nil {
 			fmt.Printf("etcd-starter: detected standby_info file. Adding --proxy=on flag to ensure node runs in v2.0 proxy mode.\n")
 			fmt.Printf("etcd-starter: before removing v0.4 data, --proxy=on flag MUST be added.\n")
 		}
 		// append proxy flag to args to trigger proxy mode
-		args = append(args, "-proxy=on")
-	default:
-		log.Panicf("etcd-starter: unhandled start version")
+		execArgs = append(execArgs, "-proxy=on")
 	}
 
-	fmt.Printf("etcd-starter: starting with %s %v with env %v\n", p, args, syscall.Environ())
-	err = syscall.Exec(p, append([]string{p}, args...), syscall.Environ())
+	fmt.Printf("etcd-starter: starting with %s %v with env %v\n", p, execArgs, syscall.Environ())
+	err = syscall.Exec(p, append([]string{p}, execArgs...), syscall.Environ())
 	if err != nil {
 		log.Fatalf("etcd-starter: failed to execute %s: %v", p, err)
 	}
 }
 
-func checkInternalVersion(fs *flag.FlagSet) version {
+// Plan describes the decisions the starter would make for a given
+// invocation without starting or migrating anything. It is produced by
+// PlanDesiredVersion and by -starter-dry-run, so operators writing systemd
+// units and tests of the starter itself can see the decision tree without
+// actually launching etcd.
+type Plan struct {
+	BinPath        string      `json:"bin_path"`
+	Args           []string    `json:"args"`
+	DataDirVersion string      `json:"data_dir_version"`
+	ChosenVersion  string      `json:"chosen_version"`
+	PeerProbes     []PeerProbe `json:"peer_probes,omitempty"`
+	MigrationSteps []string    `json:"migration_steps,omitempty"`
+}
+
+// PeerProbe records the outcome of probing a set of peer URLs for their
+// internal etcd version while building a Plan.
+type PeerProbe struct {
+	URLs    []string `json:"urls"`
+	Version string   `json:"version,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (p *Plan) setDataDirVersion(v string) {
+	if p == nil {
+		return
+	}
+	p.DataDirVersion = v
+}
+
+func (p *Plan) recordPeerProbe(urls []string, ver version, err error) {
+	if p == nil {
+		return
+	}
+	pp := PeerProbe{URLs: urls}
+	if err != nil {
+		pp.Error = err.Error()
+	} else {
+		pp.Version = string(ver)
+	}
+	p.PeerProbes = append(p.PeerProbes, pp)
+}
+
+// PlanDesiredVersion runs the same decision process as StartDesiredVersion
+// but, instead of exec'ing into the chosen binary, returns a Plan
+// describing what would have happened.
+func PlanDesiredVersion(binDir string, args []string) (Plan, error) {
+	fs, err := parseConfig(args)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := &Plan{}
+	ver := checkInternalVersion(fs, plan)
+	plan.ChosenVersion = string(ver)
+
+	p, err := binPathForVersion(binDir, ver)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan.BinPath = p
+	planArgs := filterStarterFlags(args)
+	if ver == internalV2Proxy {
+		planArgs = append(planArgs, "-proxy=on")
+	}
+	plan.Args = planArgs
+	return *plan, nil
+}
+
+// starterOnlyFlags are the flags registered by parseConfig outside of
+// etcdmain.NewConfig().VisitAll; the real etcd binary doesn't know about
+// them and errors out if they're forwarded on its command line. The bool
+// indicates whether the flag is a boolFlag, i.e. whether a bare "-name"
+// (with no "=value") stands alone rather than consuming the following
+// argument.
+var starterOnlyFlags = map[string]bool{
+	"starter-probe-timeout": false,
+	"starter-dry-run":       true,
+}
+
+// filterStarterFlags strips starter-only flags out of args so they are
+// never forwarded to the real v1/v2 etcd binary or echoed back in a
+// Plan's Args.
+func filterStarterFlags(args []string) []string {
+	filtered := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		hasInlineValue := false
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			name = name[:eq]
+			hasInlineValue = true
+		}
+		isBool, isStarterFlag := starterOnlyFlags[name]
+		if !isStarterFlag || !strings.HasPrefix(arg, "-") {
+			filtered = append(filtered, arg)
+			continue
+		}
+		// A bare "-name value" for a non-bool flag consumes the next
+		// argument too; "-name=value" already carries its value inline.
+		if !hasInlineValue && !isBool && i+1 < len(args) {
+			i++
+		}
+	}
+	return filtered
+}
+
+func binPathForVersion(binDir string, ver version) (string, error) {
+	switch ver {
+	case internalV1:
+		return path.Join(binDir, "1", "etcd"), nil
+	case internalV2, internalV2Proxy:
+		return path.Join(binDir, "2", "etcd"), nil
+	default:
+		return "", fmt.Errorf("unhandled start version %s", ver)
+	}
+}
+
+// checkInternalVersion decides which internal etcd version to start. When
+// plan is non-nil it runs in dry-run mode: every sub-probe still happens,
+// but destructive steps such as MigrateFromPeers are only recorded onto
+// plan rather than carried out.
+func checkInternalVersion(fs *flag.FlagSet, plan *Plan) version {
 	// If it uses 2.0 env var explicitly, start 2.0
 	for _, name := range v2SpecialFlags {
 		if fs.Lookup(name).Value.String() != "" {
+			plan.setDataDirVersion("none")
 			return internalV2
 		}
 	}
@@ -104,6 +259,7 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 	dataDir := fs.Lookup("data-dir").Value.String()
 	if dataDir == "" {
 		fmt.Printf("etcd-starter: data-dir is not set\n")
+		plan.setDataDirVersion("none")
 		return internalV2
 	}
 	// check the data directory
@@ -112,6 +268,8 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 		log.Fatalf("etcd-starter: failed to detect etcd version in %v: %v", dataDir, err)
 	}
 	fmt.Printf("etcd-starter: detected etcd version %s in %s\n", dataver, dataDir)
+	plan.setDataDirVersion(fmt.Sprintf("%s", dataver))
+	timeout := probeTimeout(fs)
 	switch dataver {
 	case wal.WALv2_0:
 		return internalV2
@@ -120,6 +278,16 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 	case wal.WALv2_0Proxy:
 		return internalV2Proxy
 	case wal.WALv0_4:
+		if fs.Lookup("initial-cluster").Value.String() != "" {
+			// initial-cluster being set means this node is configured for
+			// a v2-style bootstrap. initial-cluster was removed from the
+			// blanket v2SpecialFlags list so the WALNotExist branch could
+			// make its own new-vs-existing decision, but that must not
+			// change the long-standing behavior here: a v0.4 data-dir
+			// plus initial-cluster still means "start v2", matching what
+			// the old unconditional short-circuit did.
+			return internalV2
+		}
 		standbyInfo, err := migrate.DecodeStandbyInfo4FromFile(standbyInfo4(dataDir))
 		if err != nil && !os.IsNotExist(err) {
 			log.Printf("etcd-starter: failed to decode standbyInfo in %v: %v", dataDir, err)
@@ -127,7 +295,9 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 		}
 		inStandbyMode := standbyInfo != nil && standbyInfo.Running
 		if inStandbyMode {
-			ver, err := checkInternalVersionByClientURLs(standbyInfo.ClientURLs(), clientTLSInfo(fs))
+			urls := standbyInfo.ClientURLs()
+			ver, err := checkInternalVersionByClientURLs(urls, clientTLSInfo(fs), timeout)
+			plan.recordPeerProbe(urls, ver, err)
 			if err != nil {
 				fmt.Printf("etcd-starter: failed to check start version through peers: %v\n", err)
 				return internalV1
@@ -139,6 +309,32 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 			}
 			return ver
 		}
+
+		// This node is a full member still holding v0.4 data. If the
+		// rest of the cluster has already moved on to v2, fetch a v2
+		// snapshot from one of those peers and migrate in place rather
+		// than starting v1 and waiting for this node to walk the
+		// upgrade on its own.
+		peerURLs := getClientURLsByPeerURLs(getPeersFromPeersFlag(fs.Lookup("peers").Value.String(), peerTLSInfo(fs)), peerTLSInfo(fs), timeout)
+		if len(peerURLs) > 0 {
+			ver, err := checkInternalVersionByClientURLs(peerURLs, clientTLSInfo(fs), timeout)
+			plan.recordPeerProbe(peerURLs, ver, err)
+			if err == nil && ver == internalV2 {
+				step := fmt.Sprintf("migrate v0.4 data in %s from peers %v to v2", dataDir, peerURLs)
+				if plan != nil {
+					plan.MigrationSteps = append(plan.MigrationSteps, step)
+					return internalV2
+				} else {
+					fmt.Printf("etcd-starter: peers %v have already migrated to v2; migrating local data in %s\n", peerURLs, dataDir)
+					if err := MigrateFromPeers(dataDir, peerURLs, clientTLSInfo(fs)); err != nil {
+						fmt.Printf("etcd-starter: failed to migrate %s from peers: %v\n", dataDir, err)
+					} else {
+						return internalV2
+					}
+				}
+			}
+		}
+
 		ver, err := checkInternalVersionByDataDir4(dataDir)
 		if err != nil {
 			log.Printf("etcd-starter: failed to check start version in %v: %v", dataDir, err)
@@ -146,6 +342,23 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 		}
 		return ver
 	case wal.WALNotExist:
+		plan.setDataDirVersion("none")
+		switch fs.Lookup("initial-cluster-state").Value.String() {
+		case "new":
+			// Bootstrapping a brand new cluster: there are no existing
+			// members to probe, so skip the network round-trips entirely.
+			return internalV2
+		case "existing":
+			urls := getPeerURLsFromInitialCluster(fs.Lookup("initial-cluster").Value.String())
+			ver, err := checkInternalVersionByClientURLs(urls, peerTLSInfo(fs), timeout)
+			plan.recordPeerProbe(urls, ver, err)
+			if err != nil {
+				fmt.Printf("etcd-starter: failed to check start version through initial-cluster peers: %v\n", err)
+				return internalV2
+			}
+			return ver
+		}
+
 		discovery := fs.Lookup("discovery").Value.String()
 		dpeers, err := getPeersFromDiscoveryURL(discovery)
 		if err != nil {
@@ -154,8 +367,9 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 		peerStr := fs.Lookup("peers").Value.String()
 		ppeers := getPeersFromPeersFlag(peerStr, peerTLSInfo(fs))
 
-		urls := getClientURLsByPeerURLs(append(dpeers, ppeers...), peerTLSInfo(fs))
-		ver, err := checkInternalVersionByClientURLs(urls, clientTLSInfo(fs))
+		urls := getClientURLsByPeerURLs(append(dpeers, ppeers...), peerTLSInfo(fs), timeout)
+		ver, err := checkInternalVersionByClientURLs(urls, clientTLSInfo(fs), timeout)
+		plan.recordPeerProbe(urls, ver, err)
 		if err != nil {
 			fmt.Printf("etcd-starter: failed to check start version through peers: %v\n", err)
 			return internalV2
@@ -170,6 +384,70 @@ func checkInternalVersion(fs *flag.FlagSet) version {
 	return internalUnknown
 }
 
+// MigrateFromPeers fetches a v2 migration snapshot from one of the given
+// v0.4 peerURLs, converts it into a v2 snapshot and an empty WAL, and
+// installs the result into dataDir. It lets a node that is still on v0.4
+// catch up to a cluster that has already migrated to v2, without exec'ing
+// into the v1 binary first. The new data is assembled in a temporary
+// directory and only swapped into place once it passes wal.DetectVersion,
+// so a failed or partial migration never corrupts the existing data-dir.
+func MigrateFromPeers(dataDir string, peerURLs []string, tls *TLSInfo) error {
+	c, err := newDefaultClient(tls, defaultProbeTimeout)
+	if err != nil {
+		return err
+	}
+
+	var snapshot []byte
+	for _, u := range peerURLs {
+		resp, err := c.Get(u + migrationSnapshotPath)
+		if err != nil {
+			fmt.Printf("etcd-starter: failed to get %s from %s: %v\n", migrationSnapshotPath, u, err)
+			continue
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			fmt.Printf("etcd-starter: failed to read migration snapshot from %s: %v\n", u, err)
+			continue
+		}
+		snapshot = b
+		break
+	}
+	if snapshot == nil {
+		return fmt.Errorf("failed to fetch a v2 migration snapshot from peers %v", peerURLs)
+	}
+
+	tmpDir, err := ioutil.TempDir(path.Dir(dataDir), "etcd-migrate")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary migration directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := migrate.WriteV2SnapshotAndWAL(tmpDir, snapshot); err != nil {
+		return fmt.Errorf("failed to materialize v2 snapshot in %s: %v", tmpDir, err)
+	}
+	if ver, err := wal.DetectVersion(tmpDir); err != nil || ver != wal.WALv2_0 {
+		return fmt.Errorf("migrated data in %s failed validation: version=%v err=%v", tmpDir, ver, err)
+	}
+
+	// Swap the old and new data in two renames, with the old data always
+	// reachable at dataDir or backupDir, so a crash or failed rename in
+	// between never loses the v0.4 data.
+	backupDir := dataDir + ".migrate-bak"
+	os.RemoveAll(backupDir)
+	if err := os.Rename(dataDir, backupDir); err != nil {
+		return fmt.Errorf("failed to back up %s: %v", dataDir, err)
+	}
+	if err := os.Rename(tmpDir, dataDir); err != nil {
+		if rerr := os.Rename(backupDir, dataDir); rerr != nil {
+			return fmt.Errorf("failed to move migrated data into %s: %v (and failed to restore backup: %v)", dataDir, err, rerr)
+		}
+		return fmt.Errorf("failed to move migrated data into %s: %v", dataDir, err)
+	}
+	os.RemoveAll(backupDir)
+	return nil
+}
+
 func checkInternalVersionByDataDir4(dataDir string) (version, error) {
 	// check v0.4 snapshot
 	snap4, err := migrate.DecodeLatestSnapshot4FromDir(snapDir4(dataDir))
@@ -209,60 +487,107 @@ func checkInternalVersionByDataDir4(dataDir string) (version, error) {
 	return internalV1, nil
 }
 
-func getClientURLsByPeerURLs(peers []string, tls *TLSInfo) []string {
-	c, err := newDefaultClient(tls)
+func getClientURLsByPeerURLs(peers []string, tls *TLSInfo, timeout time.Duration) []string {
+	c, err := newDefaultClient(tls, timeout)
 	if err != nil {
 		fmt.Printf("etcd-starter: new client error: %v\n", err)
 		return nil
 	}
+
+	type result struct {
+		url string
+		val string
+		err error
+	}
+	results := make([]result, len(peers))
+	sem := make(chan struct{}, maxConcurrentProbes)
+	var wg sync.WaitGroup
+	for i, u := range peers {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			resp, err := c.Get(u + "/etcdURL")
+			if err != nil {
+				results[i] = result{url: u, err: err}
+				return
+			}
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			results[i] = result{url: u, val: string(b), err: err}
+		}(i, u)
+	}
+	wg.Wait()
+
 	var urls []string
-	for _, u := range peers {
-		resp, err := c.Get(u + "/etcdURL")
-		if err != nil {
-			fmt.Printf("etcd-starter: failed to get /etcdURL from %s\n", u)
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Printf("etcd-starter: failed to get /etcdURL from %s: %v\n", r.url, r.err)
 			continue
 		}
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Printf("etcd-starter: failed to read body from %s\n", u)
-			continue
-		}
-		urls = append(urls, string(b))
+		urls = append(urls, r.val)
 	}
 	return urls
 }
 
-func checkInternalVersionByClientURLs(urls []string, tls *TLSInfo) (version, error) {
-	c, err := newDefaultClient(tls)
+func checkInternalVersionByClientURLs(urls []string, tls *TLSInfo, timeout time.Duration) (version, error) {
+	c, err := newDefaultClient(tls, timeout)
 	if err != nil {
 		return internalUnknown, err
 	}
-	for _, u := range urls {
-		resp, err := c.Get(u + "/version")
-		if err != nil {
-			fmt.Printf("etcd-starter: failed to get /version from %s\n", u)
-			continue
-		}
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Printf("etcd-starter: failed to read body from %s\n", u)
-			continue
-		}
 
-		var m map[string]string
-		err = json.Unmarshal(b, &m)
-		if err != nil {
-			fmt.Printf("etcd-starter: failed to unmarshal body %s from %s\n", b, u)
+	type result struct {
+		url string
+		ver version
+		err error
+	}
+	results := make([]result, len(urls))
+	sem := make(chan struct{}, maxConcurrentProbes)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = result{url: u, ver: internalUnknown}
+
+			resp, err := c.Get(u + "/version")
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			defer resp.Body.Close()
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				results[i].err = err
+				return
+			}
+
+			var m map[string]string
+			if err := json.Unmarshal(b, &m); err != nil {
+				results[i].err = fmt.Errorf("failed to unmarshal body %s: %v", b, err)
+				return
+			}
+			switch m["internalVersion"] {
+			case "1":
+				results[i].ver = internalV1
+			case "2":
+				results[i].ver = internalV2
+			default:
+				results[i].err = fmt.Errorf("unrecognized internal version %s", m["internalVersion"])
+			}
+		}(i, u)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Printf("etcd-starter: failed to get /version from %s: %v\n", r.url, r.err)
 			continue
 		}
-		switch m["internalVersion"] {
-		case "1":
-			return internalV1, nil
-		case "2":
-			return internalV2, nil
-		default:
-			fmt.Printf("etcd-starter: unrecognized internal version %s from %s\n", m["internalVersion"], u)
-		}
+		return r.ver, nil
 	}
 	return internalUnknown, fmt.Errorf("failed to get version from urls %v", urls)
 }
@@ -278,8 +603,12 @@ func getPeersFromDiscoveryURL(discoverURL string) ([]string, error) {
 	}
 	token := u.Path
 	u.Path = ""
+	tr, err := transport.NewTransport(TLSInfo{}, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
 	cfg := client.Config{
-		Transport: &http.Transport{},
+		Transport: tr,
 		Endpoints: []string{u.String()},
 	}
 	c, err := client.New(cfg)
@@ -313,16 +642,27 @@ func getPeersFromPeersFlag(str string, tls *TLSInfo) []string {
 	return peers
 }
 
-func newDefaultClient(tls *TLSInfo) (*http.Client, error) {
-	tr := &http.Transport{}
-	if tls.Scheme() == "https" {
-		tlsConfig, err := tls.ClientConfig()
-		if err != nil {
-			return nil, err
+// getPeerURLsFromInitialCluster extracts peer URLs out of a
+// --initial-cluster value of the form "name=url,name=url,...". Unlike
+// --peers, the URLs here already carry their scheme.
+func getPeerURLsFromInitialCluster(str string) []string {
+	var urls []string
+	for _, pair := range trimSplit(str, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
 		}
-		tr.TLSClientConfig = tlsConfig
+		urls = append(urls, parts[1])
 	}
-	return &http.Client{Transport: tr}, nil
+	return urls
+}
+
+func newDefaultClient(tls *TLSInfo, timeout time.Duration) (*http.Client, error) {
+	tr, err := transport.NewTransport(*tls, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: tr, Timeout: timeout}, nil
 }
 
 type value struct {
@@ -353,6 +693,8 @@ func parseConfig(args []string) (*flag.FlagSet, error) {
 		_, isBoolFlag := f.Value.(boolFlag)
 		fs.Var(&value{isBoolFlag: isBoolFlag}, f.Name, "")
 	})
+	fs.Var(&value{s: defaultProbeTimeout.String()}, "starter-probe-timeout", "timeout for the starter's own peer/discovery HTTP probes")
+	fs.Var(&value{isBoolFlag: true, s: "false"}, "starter-dry-run", "print the starter's decision plan as JSON instead of exec'ing etcd")
 	if err := fs.Parse(args); err != nil && err != flag.ErrHelp {
 		return nil, err
 	}
@@ -378,6 +720,21 @@ func peerTLSInfo(fs *flag.FlagSet) *TLSInfo {
 	}
 }
 
+// dryRun reports whether -starter-dry-run was set.
+func dryRun(fs *flag.FlagSet) bool {
+	return fs.Lookup("starter-dry-run").Value.String() == "true"
+}
+
+// probeTimeout returns the -starter-probe-timeout value, falling back to
+// defaultProbeTimeout if it is unset or unparseable.
+func probeTimeout(fs *flag.FlagSet) time.Duration {
+	d, err := time.ParseDuration(fs.Lookup("starter-probe-timeout").Value.String())
+	if err != nil {
+		return defaultProbeTimeout
+	}
+	return d
+}
+
 func snapDir4(dataDir string) string {
 	return path.Join(dataDir, "snapshot")
 }
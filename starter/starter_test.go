@@ -0,0 +1,190 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starter
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newMissingDataDir returns a path that does not exist, so
+// wal.DetectVersion reports wal.WALNotExist for it. The returned cleanup
+// func removes the parent directory the path was carved out of.
+func newMissingDataDir(t *testing.T) (dir string, cleanup func()) {
+	t.Helper()
+	parent, err := ioutil.TempDir("", "etcd-starter-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	return filepath.Join(parent, "missing"), func() { os.RemoveAll(parent) }
+}
+
+func testFlagSet(t *testing.T, dataDir string, extra ...string) *flag.FlagSet {
+	t.Helper()
+	args := append([]string{"-data-dir", dataDir}, extra...)
+	fs, err := parseConfig(args)
+	if err != nil {
+		t.Fatalf("parseConfig(%v) = %v", args, err)
+	}
+	return fs
+}
+
+func TestCheckInternalVersionInitialClusterStateNew(t *testing.T) {
+	dataDir, cleanup := newMissingDataDir(t)
+	defer cleanup()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		json.NewEncoder(w).Encode(map[string]string{"internalVersion": "1"})
+	}))
+	defer srv.Close()
+
+	fs := testFlagSet(t, dataDir,
+		"-initial-cluster-state", "new",
+		"-initial-cluster", "default="+srv.URL)
+
+	if ver := checkInternalVersion(fs, nil); ver != internalV2 {
+		t.Errorf("checkInternalVersion() = %s, want %s", ver, internalV2)
+	}
+	if hits != 0 {
+		t.Errorf("expected no peer probes when bootstrapping a new cluster, got %d", hits)
+	}
+}
+
+func TestCheckInternalVersionInitialClusterStateExistingReachable(t *testing.T) {
+	dataDir, cleanup := newMissingDataDir(t)
+	defer cleanup()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		json.NewEncoder(w).Encode(map[string]string{"internalVersion": "1"})
+	}))
+	defer srv.Close()
+
+	fs := testFlagSet(t, dataDir,
+		"-initial-cluster-state", "existing",
+		"-initial-cluster", "default="+srv.URL)
+
+	if ver := checkInternalVersion(fs, nil); ver != internalV1 {
+		t.Errorf("checkInternalVersion() = %s, want %s", ver, internalV1)
+	}
+	if hits != 1 {
+		t.Errorf("expected exactly one peer probe, got %d", hits)
+	}
+}
+
+func TestCheckInternalVersionInitialClusterStateExistingUnreachable(t *testing.T) {
+	dataDir, cleanup := newMissingDataDir(t)
+	defer cleanup()
+
+	// Start and immediately close a server so its address is valid but
+	// refuses connections.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachableURL := srv.URL
+	srv.Close()
+
+	fs := testFlagSet(t, dataDir,
+		"-initial-cluster-state", "existing",
+		"-initial-cluster", "default="+unreachableURL)
+
+	if ver := checkInternalVersion(fs, nil); ver != internalV2 {
+		t.Errorf("checkInternalVersion() = %s, want %s", ver, internalV2)
+	}
+}
+
+func TestCheckInternalVersionLegacyPeersFallback(t *testing.T) {
+	dataDir, cleanup := newMissingDataDir(t)
+	defer cleanup()
+
+	etcdURLHits, versionHits := 0, 0
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/etcdURL", func(w http.ResponseWriter, r *http.Request) {
+		etcdURLHits++
+		w.Write([]byte(srv.URL))
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		versionHits++
+		json.NewEncoder(w).Encode(map[string]string{"internalVersion": "2"})
+	})
+
+	// getPeersFromPeersFlag wants a bare host:port and adds the scheme
+	// itself, matching the legacy -peers flag format.
+	host := srv.Listener.Addr().String()
+	fs := testFlagSet(t, dataDir, "-peers", host)
+
+	if ver := checkInternalVersion(fs, nil); ver != internalV2 {
+		t.Errorf("checkInternalVersion() = %s, want %s", ver, internalV2)
+	}
+	if etcdURLHits != 1 || versionHits != 1 {
+		t.Errorf("expected one /etcdURL and one /version probe, got %d and %d", etcdURLHits, versionHits)
+	}
+}
+
+func TestFilterStarterFlags(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{
+			in:   []string{"-data-dir", "/tmp/d", "-starter-probe-timeout", "3s", "-peers", "a,b"},
+			want: []string{"-data-dir", "/tmp/d", "-peers", "a,b"},
+		},
+		{
+			in:   []string{"-starter-dry-run", "-data-dir", "/tmp/d"},
+			want: []string{"-data-dir", "/tmp/d"},
+		},
+		{
+			in:   []string{"-starter-dry-run=true", "-starter-probe-timeout=5s", "-data-dir", "/tmp/d"},
+			want: []string{"-data-dir", "/tmp/d"},
+		},
+	}
+	for i, tt := range tests {
+		if got := filterStarterFlags(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: filterStarterFlags(%v) = %v, want %v", i, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPlanDesiredVersionStripsStarterFlags(t *testing.T) {
+	dataDir, cleanup := newMissingDataDir(t)
+	defer cleanup()
+
+	plan, err := PlanDesiredVersion("/bin", []string{
+		"-data-dir", dataDir,
+		"-initial-cluster-state", "new",
+		"-starter-probe-timeout", "1s",
+		"-starter-dry-run",
+	})
+	if err != nil {
+		t.Fatalf("PlanDesiredVersion() error = %v", err)
+	}
+	for _, a := range plan.Args {
+		if strings.HasPrefix(a, "-starter-") {
+			t.Errorf("plan.Args = %v contains a starter-only flag %q", plan.Args, a)
+		}
+	}
+}